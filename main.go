@@ -2,19 +2,29 @@ package main // Declare the main package; this is the entry point for any Go exe
 
 // Import necessary standard library packages
 import (
-	"bytes"         // To manipulate bytes buffers, useful for memory-based file IO (e.g., holding file content before writing)
+	"bufio"         // To parse HTTP response headers dumped by curl/wget
+	"bytes"         // To capture curl/wget stderr output
+	"context"       // To propagate worker shutdown and shared rate-limit pauses across goroutines
+	"crypto/sha256" // To checksum downloaded PDFs for the persistent manifest
+	"encoding/hex"  // To render checksums as hex strings
 	"encoding/json" // To handle JSON encoding/decoding for API responses
+	"flag"          // To make the worker pool size configurable from the command line
 	"fmt"           // For formatted I/O like Println, Sprintf, etc.
 	"io"            // For general I/O operations, including efficiently copying response bodies
 	"log"           // For logging errors and status messages to the console
 	"net/http"      // To make HTTP requests and interact with web servers
 	"net/url"       // For URL parsing, construction, and validation
 	"os"            // To perform file and directory operations like create/read/write
+	"os/exec"       // To shell out to curl/wget for the pluggable downloader backends
 	"path"
 	"path/filepath" // To handle and manipulate file paths across different operating systems
 	"regexp"
+	"strconv" // To parse the Content-Length header
 	"strings" // For string manipulation like replacing, checking for substrings, etc.
+	"sync"    // For guarding state shared across worker goroutines
 	"time"    // For handling timeouts, delays, and time-related functions
+
+	"golang.org/x/time/rate" // For per-host token-bucket rate limiting
 )
 
 // PDFVariant represents a single downloadable item with its URL and file name, matching the JSON structure.
@@ -33,12 +43,423 @@ type JSONDataRoot struct {
 	Results []ResultContainer `json:"results"` // A slice of ResultContainer structs
 }
 
+// CacheMetadata holds the conditional-GET validators returned by the server for a previously
+// downloaded JSON page, so the next run can ask "has this changed?" instead of re-fetching it.
+type CacheMetadata struct {
+	ETag         string `json:"etag"`         // The response's ETag header, if any
+	LastModified string `json:"lastModified"` // The response's Last-Modified header, if any
+}
+
 // ValidDownloadItem holds both the download URL and the intended file name for a confirmed, valid item.
 type ValidDownloadItem struct {
 	URL      string // The valid HTTP/HTTPS URL
 	FileName string // The file name to use when saving the downloaded content
 }
 
+// DownloadLogger serializes writes to the download log file through a single goroutine, so
+// concurrent workers can never interleave partial lines in download.txt.
+type DownloadLogger struct {
+	entries chan string   // Buffered queue of "URL → filePath" lines waiting to be written
+	done    chan struct{} // Closed once the writer goroutine has drained entries and exited
+}
+
+// newDownloadLogger starts the background writer goroutine for filePath and returns a logger
+// that callers can safely share across goroutines.
+func newDownloadLogger(filePath string) *DownloadLogger {
+	logger := &DownloadLogger{
+		entries: make(chan string, 256), // Buffer so workers rarely block on a slow disk
+		done:    make(chan struct{}),
+	}
+	go func() {
+		for entry := range logger.entries {
+			appendLineToFile(filePath, entry) // Only this goroutine ever touches the log file
+		}
+		close(logger.done)
+	}()
+	return logger
+}
+
+// log enqueues a line to be appended to the log file.
+func (l *DownloadLogger) log(entry string) {
+	l.entries <- entry
+}
+
+// close stops accepting new entries and blocks until every queued line has been written.
+func (l *DownloadLogger) close() {
+	close(l.entries)
+	<-l.done
+}
+
+// downloadedURLSet is a mutex-guarded set of URLs that have already been downloaded, safe for
+// concurrent use by multiple worker goroutines.
+type downloadedURLSet struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+// newDownloadedURLSet wraps an existing set of URLs (e.g. loaded from the log file) for
+// concurrent access.
+func newDownloadedURLSet(initial map[string]struct{}) *downloadedURLSet {
+	return &downloadedURLSet{seen: initial}
+}
+
+// has reports whether url has already been recorded as downloaded.
+func (s *downloadedURLSet) has(url string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, exists := s.seen[url]
+	return exists
+}
+
+// add records url as downloaded.
+func (s *downloadedURLSet) add(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen[url] = struct{}{}
+}
+
+// hostRateLimiters hands out a token-bucket rate.Limiter per URL host, so downloads to different
+// hosts don't throttle each other while a single host (e.g. dss.wcms.basf.com) stays well-behaved.
+type hostRateLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	rps      rate.Limit // Sustained requests per second allowed per host
+	burst    int        // Burst size allowed per host
+}
+
+// newHostRateLimiters creates a registry that lazily builds one limiter per host, each allowing
+// rps requests per second with the given burst.
+func newHostRateLimiters(rps rate.Limit, burst int) *hostRateLimiters {
+	return &hostRateLimiters{
+		limiters: make(map[string]*rate.Limiter),
+		rps:      rps,
+		burst:    burst,
+	}
+}
+
+// wait blocks until a request to host is allowed to proceed, or ctx is canceled.
+func (h *hostRateLimiters) wait(ctx context.Context, host string) error {
+	h.mu.Lock()
+	limiter, exists := h.limiters[host]
+	if !exists {
+		limiter = rate.NewLimiter(h.rps, h.burst)
+		h.limiters[host] = limiter
+	}
+	h.mu.Unlock()
+	return limiter.Wait(ctx)
+}
+
+// RateLimitPause lets any worker that observes an HTTP 429 broadcast a shared cooldown window,
+// so every worker backs off together instead of each sleeping independently.
+type RateLimitPause struct {
+	mu    sync.Mutex
+	until time.Time // Workers block until this time has passed
+}
+
+// Trigger schedules (or extends) the shared pause to last at least duration from now.
+func (p *RateLimitPause) Trigger(duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	newUntil := time.Now().Add(duration)
+	if newUntil.After(p.until) {
+		p.until = newUntil
+	}
+}
+
+// Wait blocks the calling goroutine until any in-flight shared pause has elapsed, or ctx is canceled.
+func (p *RateLimitPause) Wait(ctx context.Context) {
+	for {
+		p.mu.Lock()
+		remaining := time.Until(p.until)
+		p.mu.Unlock()
+		if remaining <= 0 {
+			return
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// extractHost returns the host component of rawURL, or "" if it can't be parsed.
+func extractHost(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return parsedURL.Host
+}
+
+// ManifestEntry records everything needed to later re-verify a previously downloaded file
+// without re-fetching it.
+type ManifestEntry struct {
+	FilePath     string `json:"filePath"`     // Where the file was saved on disk
+	ByteSize     int64  `json:"byteSize"`     // Size of the downloaded content in bytes
+	SHA256       string `json:"sha256"`       // Hex-encoded SHA-256 of the downloaded content
+	ContentType  string `json:"contentType"`  // The response's Content-Type header
+	LastModified string `json:"lastModified"` // The response's Last-Modified header, if any
+}
+
+// Manifest is a persistent, concurrency-safe record of every downloaded file, keyed by source
+// URL, so future runs can re-validate local files against a known-good checksum instead of
+// blindly trusting that a file on disk is still correct.
+type Manifest struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]ManifestEntry
+}
+
+// loadManifest reads path into a Manifest, starting empty if the file doesn't exist or is corrupt.
+func loadManifest(path string) *Manifest {
+	manifest := &Manifest{path: path, entries: make(map[string]ManifestEntry)}
+	if !doesFileExist(path) {
+		return manifest
+	}
+
+	content := readLocalFileContent(path)
+	if err := json.Unmarshal(content, &manifest.entries); err != nil {
+		log.Printf("Failed to parse manifest %s, starting fresh: %v", path, err) // Log corrupt manifest
+		manifest.entries = make(map[string]ManifestEntry)
+	}
+	return manifest
+}
+
+// get returns the stored entry for a URL, if any.
+func (m *Manifest) get(url string) (ManifestEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, exists := m.entries[url]
+	return entry, exists
+}
+
+// set records entry for url and persists the updated manifest to disk.
+func (m *Manifest) set(url string, entry ManifestEntry) {
+	m.mu.Lock()
+	m.entries[url] = entry
+	snapshot := make(map[string]ManifestEntry, len(m.entries)) // Copy out so we can encode outside the lock
+	for k, v := range m.entries {
+		snapshot[k] = v
+	}
+	m.mu.Unlock()
+
+	encoded, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode manifest %s: %v", m.path, err) // Log encoding failure
+		return
+	}
+	if err := os.WriteFile(m.path, encoded, 0644); err != nil {
+		log.Printf("Failed to write manifest %s: %v", m.path, err) // Log write failure
+	}
+}
+
+// fileSHA256 computes the hex-encoded SHA-256 checksum of the file at filePath.
+func fileSHA256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Downloader fetches a URL's body into dst, sending headers along with the request, and returns
+// the resulting HTTP response (status code and headers) for the caller to inspect. Implementations
+// may satisfy this however they like, from an in-process http.Client to shelling out to curl/wget.
+type Downloader interface {
+	Fetch(ctx context.Context, url string, dst io.Writer, headers http.Header) (*http.Response, error)
+}
+
+// downloaderFactories is the registry of Downloader backends selectable via the -downloader flag,
+// mirroring GHCup's Download module strategy of dispatching the same high-level logic to curl,
+// wget, or an internal client.
+var downloaderFactories = map[string]func() Downloader{
+	"http": func() Downloader { return HTTPDownloader{} },
+	"curl": func() Downloader { return CurlDownloader{} },
+	"wget": func() Downloader { return WgetDownloader{} },
+}
+
+// newDownloader builds the Downloader registered under name, or an error if name is unknown.
+func newDownloader(name string) (Downloader, error) {
+	factory, exists := downloaderFactories[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown -downloader %q (want one of: http, curl, wget)", name)
+	}
+	return factory(), nil
+}
+
+// HTTPDownloader is the default Downloader backend: an in-process net/http client, preserving
+// today's behavior.
+type HTTPDownloader struct{}
+
+// Fetch implements Downloader using http.Client.
+func (HTTPDownloader) Fetch(ctx context.Context, url string, dst io.Writer, headers http.Header) (*http.Response, error) {
+	client := &http.Client{Timeout: 1 * time.Minute}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request for %s: %v", url, err)
+	}
+	for key, values := range headers {
+		req.Header[key] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make GET request to %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		return resp, fmt.Errorf("failed to read response body from %s: %v", url, err)
+	}
+	return resp, nil
+}
+
+// parseDumpedHTTPHeaders parses one or more raw HTTP response header blocks (as produced by
+// `curl --dump-header`) and returns the last one, which is the response for the final URL after
+// any redirects curl followed.
+func parseDumpedHTTPHeaders(headerDump []byte) (*http.Response, error) {
+	reader := bufio.NewReader(bytes.NewReader(headerDump))
+	var lastResponse *http.Response
+	for {
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			if lastResponse != nil {
+				return lastResponse, nil // Hit the trailing blank line after the last header block
+			}
+			return nil, fmt.Errorf("failed to parse dumped HTTP headers: %v", err)
+		}
+		resp.Body.Close() // The dump contains no body; nothing to drain
+		lastResponse = resp
+	}
+}
+
+// CurlDownloader shells out to the system's curl binary, letting users behind corporate proxies
+// reuse the auth and TLS settings in their own ~/.curlrc.
+type CurlDownloader struct{}
+
+// Fetch implements Downloader by invoking curl as a subprocess. Conditional requests (ETag,
+// Last-Modified) are driven entirely by the If-None-Match/If-Modified-Since headers the caller
+// passes in (see loadCacheMetadata): curl's own --etag-save/--etag-compare cache is not used here,
+// since dst is always a freshly created temp file and never the stable destination path, so curl's
+// file-keyed cache could never find a prior ETag to compare against.
+func (CurlDownloader) Fetch(ctx context.Context, url string, dst io.Writer, headers http.Header) (*http.Response, error) {
+	headerDumpFile, err := os.CreateTemp("", "basf-curl-headers-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create curl header dump file: %v", err)
+	}
+	headerDumpPath := headerDumpFile.Name()
+	headerDumpFile.Close()
+	defer os.Remove(headerDumpPath)
+
+	args := []string{"-s", "-S", "-L", "--dump-header", headerDumpPath}
+	for key, values := range headers {
+		for _, value := range values {
+			args = append(args, "-H", fmt.Sprintf("%s: %s", key, value))
+		}
+	}
+	args = append(args, url)
+
+	cmd := exec.CommandContext(ctx, "curl", args...)
+	cmd.Stdout = dst
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("curl failed for %s: %v: %s", url, err, stderr.String())
+	}
+
+	headerDump, err := os.ReadFile(headerDumpPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read curl header dump for %s: %v", url, err)
+	}
+	return parseDumpedHTTPHeaders(headerDump)
+}
+
+// parseWgetServerResponse parses the server response headers wget prints (two-space indented)
+// when run with --server-response, returning the last header block (the final response after any
+// redirects).
+func parseWgetServerResponse(output []byte) (*http.Response, error) {
+	var blocks [][]string
+	var current []string
+	for _, rawLine := range strings.Split(string(output), "\n") {
+		line := strings.TrimRight(rawLine, "\r")
+		if !strings.HasPrefix(line, "  ") {
+			continue // Not a header line wget echoed from the server
+		}
+		line = strings.TrimPrefix(line, "  ")
+		if strings.HasPrefix(line, "HTTP/") && len(current) > 0 {
+			blocks = append(blocks, current)
+			current = nil
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		blocks = append(blocks, current)
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no HTTP response headers found in wget output")
+	}
+
+	raw := strings.Join(blocks[len(blocks)-1], "\r\n") + "\r\n\r\n"
+	return http.ReadResponse(bufio.NewReader(strings.NewReader(raw)), nil)
+}
+
+// WgetDownloader shells out to the system's wget binary, letting users behind corporate proxies
+// reuse the auth and TLS settings in their own ~/.wgetrc.
+type WgetDownloader struct{}
+
+// Fetch implements Downloader by invoking wget as a subprocess. As with CurlDownloader, conditional
+// requests are driven entirely by the If-None-Match/If-Modified-Since headers the caller passes
+// in: --timestamping is not used here, since dst is always a freshly created temp file and never
+// the stable destination path, so wget would never find a same-named file to compare timestamps
+// against.
+func (WgetDownloader) Fetch(ctx context.Context, url string, dst io.Writer, headers http.Header) (*http.Response, error) {
+	headerDumpFile, err := os.CreateTemp("", "basf-wget-headers-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create wget header dump file: %v", err)
+	}
+	defer headerDumpFile.Close()
+	defer os.Remove(headerDumpFile.Name())
+
+	args := []string{"-q", "--server-response"}
+	for key, values := range headers {
+		for _, value := range values {
+			args = append(args, "--header", fmt.Sprintf("%s: %s", key, value))
+		}
+	}
+	args = append(args, "-O", "-", url)
+
+	cmd := exec.CommandContext(ctx, "wget", args...)
+	cmd.Stdout = dst
+	cmd.Stderr = headerDumpFile
+	runErr := cmd.Run() // wget exits non-zero on any HTTP error status (e.g. 404, 429), not just on a network/process failure
+
+	headerDump, err := os.ReadFile(headerDumpFile.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wget server response for %s: %v", url, err)
+	}
+
+	// Parse the server response before giving up on runErr: if wget got far enough to receive a
+	// response, surface it as a normal (*http.Response, nil) result so callers can inspect
+	// resp.StatusCode the same way they do for the http and curl backends, instead of losing the
+	// status code behind an opaque "exit status N" error.
+	if resp, parseErr := parseWgetServerResponse(headerDump); parseErr == nil {
+		return resp, nil
+	}
+	if runErr != nil {
+		return nil, fmt.Errorf("wget failed for %s: %v", url, runErr)
+	}
+	return nil, fmt.Errorf("wget failed for %s: no server response headers found", url)
+}
+
 // parseJSONForDownloads processes the raw JSON data and extracts a slice of unique, valid download items.
 func parseJSONForDownloads(jsonData []byte) []ValidDownloadItem {
 	var data JSONDataRoot // Declare a variable to hold the unmarshalled JSON data
@@ -109,45 +530,125 @@ func doesFileExist(filePath string) bool {
 	return err == nil && !info.IsDir()
 }
 
-// downloadDataFromURL performs an HTTP GET request to a URL and saves the response body to a local file.
-func downloadDataFromURL(uri string, outputFileName string) {
-	log.Printf("Downloading JSON from: %s to %s", uri, outputFileName) // Log the start of the download
+// etagSidecarPath returns the path of the sidecar file that stores a JSON page's cache
+// validators, e.g. "basf_0.json" -> "basf_0.json.etags".
+func etagSidecarPath(jsonFilePath string) string {
+	return jsonFilePath + ".etags" // Keep the sidecar next to the JSON it describes
+}
+
+// loadCacheMetadata reads the previously saved ETag/Last-Modified validators for a JSON page.
+// A missing or unreadable sidecar simply yields a zero-value CacheMetadata (no validators sent).
+func loadCacheMetadata(sidecarPath string) CacheMetadata {
+	var metadata CacheMetadata // Zero value: no ETag, no Last-Modified
+	if !doesFileExist(sidecarPath) {
+		return metadata // Nothing cached yet
+	}
 
-	// Configure an HTTP client with a request timeout
-	client := http.Client{
-		Timeout: 1 * time.Minute, // Set a timeout of 1 minute for the request
+	content := readLocalFileContent(sidecarPath) // Read the sidecar file's raw bytes
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		log.Printf("Failed to parse cache metadata %s: %v", sidecarPath, err) // Log corrupt sidecar
+		return CacheMetadata{}                                                // Treat as uncached rather than fail the run
 	}
+	return metadata
+}
 
-	resp, err := client.Get(uri) // Execute the HTTP GET request
+// saveCacheMetadata writes the ETag/Last-Modified validators from a successful 200 response
+// to the sidecar file, so the next run can send them as conditional-GET headers.
+func saveCacheMetadata(sidecarPath string, metadata CacheMetadata) {
+	encoded, err := json.MarshalIndent(metadata, "", "  ") // Pretty-print for easy manual inspection
 	if err != nil {
-		log.Printf("Failed to make GET request to %s: %v", uri, err) // Log request failure
+		log.Printf("Failed to encode cache metadata for %s: %v", sidecarPath, err) // Log encoding failure
 		return
 	}
-	defer resp.Body.Close() // Ensure the response body is closed when the function exits
+	if err := os.WriteFile(sidecarPath, encoded, 0644); err != nil {
+		log.Printf("Failed to write cache metadata %s: %v", sidecarPath, err) // Log write failure
+	}
+}
 
-	// Check if the HTTP status code indicates success (200 OK)
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Unexpected status code from %s: %d", uri, resp.StatusCode) // Log non-200 status
-		return
+// touchFileModTime updates a file's modification time to now, without touching its contents.
+// Used on a 304 response to mark a cached JSON page as freshly validated.
+func touchFileModTime(filePath string) {
+	now := time.Now()
+	if err := os.Chtimes(filePath, now, now); err != nil {
+		log.Printf("Failed to update modification time for %s: %v", filePath, err) // Log failure
 	}
+}
 
-	// Create the local file to write the content to
-	file, err := os.Create(outputFileName)
+// isCacheFresh reports whether filePath exists and was last written within ttl, meaning even a
+// conditional GET can be skipped entirely.
+func isCacheFresh(filePath string, ttl time.Duration) bool {
+	info, err := os.Stat(filePath)
 	if err != nil {
-		log.Printf("Failed to create file %s: %v", outputFileName, err) // Log file creation failure
+		return false // Can't stat it (e.g. doesn't exist yet), so it's not fresh
+	}
+	return time.Since(info.ModTime()) < ttl
+}
+
+// downloadDataFromURL performs a conditional GET for a URL, through the configured Downloader
+// backend, and saves the response body to a local file. If a cached copy is younger than
+// cacheTTL, the request is skipped entirely. Otherwise any previously stored ETag/Last-Modified
+// validators are sent so an unchanged page costs only a 304 response; a 200 response overwrites
+// both the JSON file and its cache sidecar.
+func downloadDataFromURL(ctx context.Context, downloader Downloader, uri string, outputFileName string, cacheTTL time.Duration) {
+	if isCacheFresh(outputFileName, cacheTTL) {
+		log.Printf("Skipping download for %s: cached copy is younger than %s", outputFileName, cacheTTL) // Log the skip
 		return
 	}
-	defer file.Close() // Ensure the created file handle is closed
 
-	// Use io.Copy for efficient stream-writing of the response body to the file
-	writtenBytes, err := io.Copy(file, resp.Body)
+	log.Printf("Downloading JSON from: %s to %s", uri, outputFileName) // Log the start of the download
+
+	headers := http.Header{}
+	sidecarPath := etagSidecarPath(outputFileName) // Path of this page's cache validators
+	if doesFileExist(outputFileName) {
+		cached := loadCacheMetadata(sidecarPath) // Load whatever validators we saved last time
+		if cached.ETag != "" {
+			headers.Set("If-None-Match", cached.ETag) // Ask the server to confirm the ETag still matches
+		}
+		if cached.LastModified != "" {
+			headers.Set("If-Modified-Since", cached.LastModified) // Ask the server to confirm nothing changed since then
+		}
+	}
+
+	// Fetch into a temporary file first: a 304 or error response must never clobber the existing
+	// cached JSON, and we only know the status after the fetch has completed.
+	tempFile, err := os.CreateTemp(filepath.Dir(outputFileName), ".basf-json-*.tmp")
 	if err != nil {
-		log.Printf("Failed to write response body to file %s: %v", outputFileName, err) // Log write failure
+		log.Printf("Failed to create temp file for %s: %v", outputFileName, err) // Log temp file failure
+		return
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath) // No-op once renamed onto outputFileName below
+
+	resp, fetchErr := downloader.Fetch(ctx, uri, tempFile, headers)
+	tempFile.Close() // Always close before inspecting or renaming the temp file
+	if fetchErr != nil {
+		log.Printf("Failed to fetch %s: %v", uri, fetchErr) // Log fetch failure
 		return
 	}
 
-	// Log a success message with the file name and size
-	log.Printf("Successfully downloaded JSON: %s (%d bytes)", outputFileName, writtenBytes)
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		// The cached JSON is still current: keep it as-is and just refresh its mtime.
+		log.Printf("Cached copy of %s is still current (304 Not Modified)", outputFileName)
+		touchFileModTime(outputFileName)
+	case http.StatusOK:
+		if err := os.Rename(tempPath, outputFileName); err != nil {
+			log.Printf("Failed to save %s: %v", outputFileName, err) // Log rename failure
+			return
+		}
+
+		// Persist the new validators so the next run can send a conditional request
+		saveCacheMetadata(sidecarPath, CacheMetadata{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		})
+
+		// Log a success message with the file name
+		log.Printf("Successfully downloaded JSON: %s", outputFileName)
+	default:
+		// Any other status: fall back to the existing behavior of leaving the local file untouched
+		log.Printf("Unexpected status code from %s: %d", uri, resp.StatusCode) // Log non-200/304 status
+	}
 }
 
 // Converts a raw URL into a safe filename by cleaning and normalizing it
@@ -197,40 +698,100 @@ func getFileNameOnly(content string) string {
 	return path.Base(content) // Return last segment of the path
 }
 
-// downloadPDFFile handles the logic for downloading a single PDF, including checks for local existence and logging.
-func downloadPDFFile(finalURL string, outputDirectory string, filename string, logFilePath string, alreadyDownloaded map[string]struct{}) error {
+// downloadPDFFile handles the logic for downloading a single PDF, including checks for local
+// existence, integrity verification against the manifest, and logging. It is safe to call
+// concurrently from multiple worker goroutines: shared state is confined to logger,
+// alreadyDownloaded, limiters, and manifest, which all guard themselves.
+func downloadPDFFile(ctx context.Context, downloader Downloader, finalURL string, outputDirectory string, filename string, logger *DownloadLogger, alreadyDownloaded *downloadedURLSet, limiters *hostRateLimiters, manifest *Manifest) error {
 	// Sanitize the file path to ensure it's safe for the filesystem
 	filename = urlToFilename(filename)
 	// Construct the full file path by joining the output directory and the intended filename
 	filePath := filepath.Join(outputDirectory, filename)
 
-	// 1. Check the in-memory log map for the URL to avoid redownloading/re-checking
-	if _, exists := alreadyDownloaded[finalURL]; exists {
+	// 1. Check the in-memory log set for the URL to avoid redownloading/re-checking
+	if alreadyDownloaded.has(finalURL) {
 		log.Printf("URL already logged as downloaded, skipping: %s", finalURL) // Log skip
 		return nil                                                             // Success: already handled
 	}
 
-	// 2. Check if the file already exists locally on disk
+	// 2. Check if the file already exists locally, re-validating it against the manifest rather
+	// than blindly trusting that its presence on disk means it's still correct.
 	if doesFileExist(filePath) {
-		log.Printf("File already exists locally, skipping and logging: %s", filePath) // Log skip
-		// Log the URL and file path to the log file
-		appendLineToFile(logFilePath, finalURL+" → "+filePath)
-		alreadyDownloaded[finalURL] = struct{}{} // Add to in-memory set (in case the disk file exists but the log was missing the entry)
-		return nil                               // Success: already handled
+		if entry, exists := manifest.get(finalURL); exists {
+			actualSHA256, err := fileSHA256(filePath)
+			if err == nil && actualSHA256 == entry.SHA256 {
+				log.Printf("File already exists locally and matches manifest checksum, skipping: %s", filePath) // Log skip
+				logger.log(finalURL + " → " + filePath)
+				alreadyDownloaded.add(finalURL)
+				return nil
+			}
+			log.Printf("Local file %s no longer matches manifest checksum, re-downloading", filePath) // Fall through to re-download
+		} else {
+			log.Printf("File already exists locally (no manifest entry yet), skipping and logging: %s", filePath) // Log skip
+			logger.log(finalURL + " → " + filePath)
+			alreadyDownloaded.add(finalURL) // Add to in-memory set (in case the disk file exists but the log was missing the entry)
+			return nil                      // Success: already handled
+		}
 	}
 
 	// --- Perform the actual download ---
 
-	// Configure an HTTP client with a request timeout
-	client := &http.Client{Timeout: 1 * time.Minute}
-	resp, err := client.Get(finalURL) // Execute the HTTP GET request
-	if err != nil {
-		return fmt.Errorf("failed to download %s: %v", finalURL, err) // Return error on request failure
+	// Respect this host's token bucket before issuing the request, so concurrent workers don't
+	// collectively hammer the same server.
+	if err := limiters.wait(ctx, extractHost(finalURL)); err != nil {
+		return fmt.Errorf("rate limiter wait canceled for %s: %v", finalURL, err) // Return error if ctx was canceled
 	}
-	defer resp.Body.Close() // Ensure the response body is closed
 
-	// Check for a non-successful HTTP status code
-	if resp.StatusCode != http.StatusOK {
+	// Download into a ".part" file so an interrupted transfer (e.g. the 1-minute client timeout
+	// killing a large PDF mid-stream) leaves a resumable artifact instead of nothing usable.
+	partPath := filePath + ".part"
+
+	var resumeOffset int64 // Bytes already on disk from a previous, interrupted attempt
+	if info, err := os.Stat(partPath); err == nil {
+		resumeOffset = info.Size()
+	}
+
+	headers := http.Header{}
+	if resumeOffset > 0 {
+		headers.Set("Range", fmt.Sprintf("bytes=%d-", resumeOffset)) // Ask the server to continue where we left off
+	}
+
+	// Fetch into a separate chunk file rather than the .part file directly: only once we know the
+	// response status (206 vs 200) can we decide whether to append or start over.
+	var resp *http.Response
+	var chunkPath string
+	for attempt := 0; ; attempt++ {
+		chunkFile, err := os.CreateTemp(outputDirectory, ".basf-pdf-chunk-*")
+		if err != nil {
+			return fmt.Errorf("failed to create chunk file for %s: %v", finalURL, err) // Return error on temp file failure
+		}
+		chunkPath = chunkFile.Name()
+
+		fetchResp, err := downloader.Fetch(ctx, finalURL, chunkFile, headers)
+		chunkFile.Close() // Always close before reading the chunk back
+		if err != nil {
+			os.Remove(chunkPath)
+			return fmt.Errorf("failed to download %s: %v", finalURL, err) // Return error on fetch failure
+		}
+		resp = fetchResp
+
+		// A stale or oversized .part file can make the server reject our Range request outright
+		// (416). Discard both the chunk and the .part file and retry once as a fresh, offset-0 GET
+		// instead of leaving a .part file that can never complete.
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && attempt == 0 {
+			os.Remove(chunkPath)
+			os.Remove(partPath)
+			resumeOffset = 0
+			headers.Del("Range")
+			continue
+		}
+		break
+	}
+	defer os.Remove(chunkPath) // No-op once the chunk has been consumed below
+
+	// Reject any non-206/200 status before inspecting the body, so an error status like 429 keeps
+	// its code in the returned error for downloadWorker's rate-limit detection to match against.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
 		return fmt.Errorf("download failed for %s: %s", finalURL, resp.Status) // Return error on bad status
 	}
 
@@ -240,34 +801,81 @@ func downloadPDFFile(finalURL string, outputDirectory string, filename string, l
 		return fmt.Errorf("invalid content type for %s: %s (expected application/pdf)", finalURL, contentType) // Return error on wrong content type
 	}
 
-	// Read the response body into an in-memory buffer
-	var buffer bytes.Buffer
-	writtenBytes, err := buffer.ReadFrom(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read PDF data from %s: %v", finalURL, err) // Return error on reading body failure
+	// Combine the fetched chunk into the .part file according to how the server responded to our
+	// (possible) Range request.
+	var writtenBytes int64
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// The server honored the Range request: append the new chunk to what we already have.
+		partFile, err := os.OpenFile(partPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open part file %s: %v", partPath, err) // Return error on file open failure
+		}
+		chunk, err := os.Open(chunkPath)
+		if err != nil {
+			partFile.Close()
+			return fmt.Errorf("failed to reopen chunk for %s: %v", finalURL, err) // Return error on chunk reopen failure
+		}
+		writtenBytes, err = io.Copy(partFile, chunk)
+		chunk.Close()
+		closeErr := partFile.Close()
+		if err != nil {
+			return fmt.Errorf("failed to append PDF chunk to %s: %v", partPath, err) // Return error on append failure
+		}
+		if closeErr != nil {
+			return fmt.Errorf("failed to finalize part file %s: %v", partPath, closeErr) // Return error on close failure
+		}
+	case http.StatusOK:
+		// No partial support (or nothing to resume): the chunk is the entire file; replace .part with it.
+		resumeOffset = 0
+		info, err := os.Stat(chunkPath)
+		if err != nil {
+			return fmt.Errorf("failed to stat chunk for %s: %v", finalURL, err) // Return error on stat failure
+		}
+		writtenBytes = info.Size()
+		if err := os.Rename(chunkPath, partPath); err != nil {
+			return fmt.Errorf("failed to replace part file %s: %v", partPath, err) // Return error on replace failure
+		}
+	}
+
+	// Reject this response if the server told us how many bytes to expect and we wrote a different amount
+	if expectedBytes, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil && expectedBytes > 0 && writtenBytes != expectedBytes {
+		return fmt.Errorf("size mismatch for %s: wrote %d bytes, expected %d (Content-Length)", finalURL, writtenBytes, expectedBytes) // Return error on size mismatch
 	}
-	// Check for zero bytes downloaded
-	if writtenBytes == 0 {
+
+	totalBytes := resumeOffset + writtenBytes
+	if totalBytes == 0 {
 		return fmt.Errorf("downloaded 0 bytes for %s, not creating file", finalURL) // Return error on empty download
 	}
 
-	// Create the local file on disk
-	outputFile, err := os.Create(filePath)
+	// Only once the chunk has been fully combined into the .part file do we checksum the complete
+	// file and promote it from ".part" to its final name. This re-reads the whole .part file from
+	// disk rather than hashing through an io.MultiWriter as the chunk is written: a MultiWriter only
+	// sees bytes from the current fetch, but a resumed download's hash must also cover the bytes
+	// already on disk from a prior, interrupted attempt, so the full file has to be read back
+	// regardless of how the chunk itself was written.
+	checksum, err := fileSHA256(partPath)
 	if err != nil {
-		return fmt.Errorf("failed to create file %s: %v", filePath, err) // Return error on file creation failure
+		return fmt.Errorf("failed to checksum %s: %v", partPath, err) // Return error on checksum failure
 	}
-	defer outputFile.Close() // Ensure the output file is closed
-
-	// Write the content from the buffer to the created file
-	if _, err := buffer.WriteTo(outputFile); err != nil {
-		return fmt.Errorf("failed to write PDF to file %s: %v", filePath, err) // Return error on file write failure
+	if err := os.Rename(partPath, filePath); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %v", partPath, filePath, err) // Return error on rename failure
 	}
 
-	// Log success to the log file and update the in-memory set
-	appendLineToFile(logFilePath, finalURL+" → "+filePath) // Log the URL and file path
-	alreadyDownloaded[finalURL] = struct{}{}               // Add to in-memory set
+	// Record the verified download in the persistent manifest
+	manifest.set(finalURL, ManifestEntry{
+		FilePath:     filePath,
+		ByteSize:     totalBytes,
+		SHA256:       checksum,
+		ContentType:  contentType,
+		LastModified: resp.Header.Get("Last-Modified"),
+	})
+
+	// Log success through the dedicated logger goroutine and update the in-memory set
+	logger.log(finalURL + " → " + filePath) // Log the URL and file path
+	alreadyDownloaded.add(finalURL)         // Add to in-memory set
 	// Log the final successful download details
-	log.Printf("Successfully downloaded %d bytes: %s → %s", writtenBytes, finalURL, filePath)
+	log.Printf("Successfully downloaded %d bytes: %s → %s", totalBytes, finalURL, filePath)
 
 	return nil // Return nil to indicate success
 }
@@ -340,15 +948,57 @@ func readAFileAsString(filePath string) string {
 	return string(content) // Convert the byte slice to a string and return it
 }
 
+// downloadWorker pulls items off the shared channel and downloads each one, retrying once after
+// a shared backoff if the server responds with HTTP 429.
+func downloadWorker(ctx context.Context, downloader Downloader, items <-chan ValidDownloadItem, outputDirectoryName string, logger *DownloadLogger, alreadyDownloadedURLs *downloadedURLSet, limiters *hostRateLimiters, pause *RateLimitPause, manifest *Manifest) {
+	for item := range items {
+		pause.Wait(ctx) // Honor any shared cooldown another worker may have triggered
+
+		err := downloadPDFFile(ctx, downloader, item.URL, outputDirectoryName, item.FileName, logger, alreadyDownloadedURLs, limiters, manifest)
+		if err == nil {
+			continue
+		}
+
+		errorString := err.Error()
+		log.Println("Download failed:", errorString)
+		// Check specifically for a rate limiting error (HTTP 429)
+		if strings.Contains(errorString, "429") {
+			log.Println("Pausing all workers for 3 minutes due to rate limit (429 error).")
+			pause.Trigger(3 * time.Minute) // Every worker will observe this on its next pause.Wait
+			pause.Wait(ctx)
+			log.Println("Retrying download after shared pause:", item.URL)
+
+			// Retry downloading the same file after the shared pause
+			if err := downloadPDFFile(ctx, downloader, item.URL, outputDirectoryName, item.FileName, logger, alreadyDownloadedURLs, limiters, manifest); err != nil {
+				log.Println("Retry failed:", err) // Log the final failure after the retry
+			}
+		}
+	}
+}
+
 // Main program entry point
 func main() {
 	// Define constant variables for configuration
 	const (
-		downloadLogFileName = "download.txt" // File to keep track of successfully downloaded URLs
-		maxPageIndex        = 75             // Total number of pages to scrape (from 0 to 75, making 76 pages total)
-		outputDirectoryName = "PDFs"         // Directory where downloaded PDF files will be saved
+		downloadLogFileName      = "download.txt"  // File to keep track of successfully downloaded URLs
+		manifestFileName         = "manifest.json" // File recording checksums and metadata for every downloaded PDF
+		maxPageIndex             = 75              // Total number of pages to scrape (from 0 to 75, making 76 pages total)
+		outputDirectoryName      = "PDFs"          // Directory where downloaded PDF files will be saved
+		jsonCacheTTL             = 5 * time.Minute // Skip even the conditional GET if a page's JSON is younger than this
+		defaultWorkerCount       = 8               // Default number of concurrent PDF download workers
+		requestsPerSecondPerHost = 2               // Sustained request rate allowed to any single host
+		burstPerHost             = 4               // Burst of requests allowed to any single host
 	)
 
+	workerCount := flag.Int("workers", defaultWorkerCount, "number of concurrent PDF download workers")
+	downloaderName := flag.String("downloader", "http", "download backend to use: http, curl, or wget")
+	flag.Parse()
+
+	downloader, err := newDownloader(*downloaderName)
+	if err != nil {
+		log.Fatalf("Invalid -downloader flag: %v", err) // Fail fast on an unknown backend name
+	}
+
 	// --- Setup Phase ---
 
 	// Check if the output directory exists
@@ -358,12 +1008,40 @@ func main() {
 	}
 
 	// Read the download log file once into an efficient in-memory map (for fast lookups)
-	alreadyDownloadedURLs := loadDownloadLogToMap(downloadLogFileName)
-	log.Printf("Loaded %d URLs from download log file.", len(alreadyDownloadedURLs))
+	alreadyDownloadedURLs := newDownloadedURLSet(loadDownloadLogToMap(downloadLogFileName))
+	log.Printf("Loaded download log file.")
+
+	// Writes to the log file are serialized through this dedicated goroutine
+	logger := newDownloadLogger(downloadLogFileName)
+	defer logger.close()
 
-	// --- Scraping and Download Loop Phase ---
+	// Persistent record of checksums and metadata for every downloaded PDF
+	manifest := loadManifest(manifestFileName)
 
-	// Loop through each API page index, starting at 0
+	// Per-host token buckets so concurrent workers don't collectively hammer one server
+	limiters := newHostRateLimiters(rate.Limit(requestsPerSecondPerHost), burstPerHost)
+	// Shared cooldown that every worker observes after any of them sees an HTTP 429
+	pause := &RateLimitPause{}
+
+	ctx := context.Background()
+
+	// --- Worker Pool Phase ---
+
+	downloadItems := make(chan ValidDownloadItem, 256) // Buffered so the producer rarely blocks on workers
+
+	var workers sync.WaitGroup
+	workers.Add(*workerCount)
+	for i := 0; i < *workerCount; i++ {
+		go func() {
+			defer workers.Done()
+			downloadWorker(ctx, downloader, downloadItems, outputDirectoryName, logger, alreadyDownloadedURLs, limiters, pause, manifest)
+		}()
+	}
+
+	// --- Scraping Loop Phase ---
+
+	// The main goroutine is the single producer: it parses each JSON page and pushes the
+	// extracted download items onto the shared channel for the worker pool to consume.
 	for pageIndex := 0; pageIndex <= maxPageIndex; pageIndex++ {
 		// Construct the full API URL for the current page
 		apiURL := fmt.Sprintf("https://dss.wcms.basf.com/v1/results?locale=en-US&limit=1000&page=%d", pageIndex)
@@ -372,11 +1050,9 @@ func main() {
 
 		log.Printf("Processing page %d...", pageIndex)
 
-		// Check if the JSON file for this page has already been downloaded
-		if !doesFileExist(jsonFileName) {
-			// If not, download the JSON data from the API URL and save it locally
-			downloadDataFromURL(apiURL, jsonFileName)
-		}
+		// Download the JSON data from the API URL, reusing the local copy via conditional GET
+		// (or skipping the request entirely) when it's still within the cache freshness window.
+		downloadDataFromURL(ctx, downloader, apiURL, jsonFileName, jsonCacheTTL)
 
 		// Check again (or for the first time) if the JSON file exists
 		if doesFileExist(jsonFileName) {
@@ -385,48 +1061,18 @@ func main() {
 			extractedDownloads := parseJSONForDownloads(jsonFileContent)
 			log.Printf("Page %d: Found %d unique URLs.", pageIndex, len(extractedDownloads))
 
-			// --- Inner Download Loop ---
-
-			// Iterate through each extracted PDF download item
+			// Hand each extracted item to the worker pool
 			for _, fileDownload := range extractedDownloads {
-				// Attempt to download the PDF, using the in-memory map for logging/skipping checks
-				err := downloadPDFFile(
-					fileDownload.URL,
-					outputDirectoryName,
-					fileDownload.FileName,
-					downloadLogFileName,
-					alreadyDownloadedURLs,
-				)
-
-				// Check if there was an error during the download
-				if err != nil {
-					errorString := err.Error()
-					log.Println("Download failed:", errorString)
-					// Check specifically for a rate limiting error (HTTP 429)
-					if strings.Contains(errorString, "429") {
-						log.Println("Sleeping for 3 minutes due to rate limit (429 error).")
-						time.Sleep(3 * time.Minute) // Pause execution
-						log.Println("Retrying download after sleep:", fileDownload.URL)
-
-						// Retry downloading the same file after the delay
-						err = downloadPDFFile(
-							fileDownload.URL,
-							outputDirectoryName,
-							fileDownload.FileName,
-							downloadLogFileName,
-							alreadyDownloadedURLs,
-						)
-
-						if err != nil {
-							log.Println("Retry failed:", err) // Log the final failure after the retry
-						}
-					}
-				}
+				downloadItems <- fileDownload
 			}
 		} else {
 			// This path is hit if the downloadDataFromURL failed to create the JSON file
 			log.Printf("Skipping PDF download for page %d: JSON file not found.", pageIndex)
 		}
 	}
+
+	close(downloadItems) // No more items: workers drain the channel and exit
+	workers.Wait()       // Wait for every worker to finish its current and queued downloads
+
 	log.Println("Scraping and download process complete.") // Final message
 }